@@ -0,0 +1,109 @@
+// Copyright 2010 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"os"
+)
+
+// WriteBlocks sends every block in bs as a single DCCP-DataAck, analogous to
+// writev: the connection wakes once for the whole batch, and the CCID sees
+// one packet carrying option piggybacks for the entire burst, instead of one
+// packet per block. Unlike WriteBlock, WriteBlocks does not hand bs to a
+// background goroutine to relay one element at a time — it injects the
+// batch directly.
+//
+// WriteBlocks either sends all of bs or none of it: n is len(bs) and err is
+// nil on success; otherwise n is 0 and err explains why nothing was sent.
+// Each element of bs is still subject to the MaxBlockLen() limit.
+func (c *Conn) WriteBlocks(bs [][]byte) (n int, err os.Error) {
+	for _, b := range bs {
+		if len(b) > c.MaxBlockLen() {
+			return 0, ErrTooBig
+		}
+	}
+	c.Lock()
+	state := c.socket.GetState()
+	c.Unlock()
+	if state == WRITE_CLOSED || state == CLOSING || state == CLOSEREQ || state == CLOSED || state == TIMEWAIT {
+		return 0, ErrClosed
+	}
+	if state != OPEN && state != READ_CLOSED {
+		return 0, os.EBADF
+	}
+	if len(bs) == 0 {
+		return 0, nil
+	}
+	c.inject(c.generateDataBatch(bs))
+	return len(bs), nil
+}
+
+// ErrShortBuffer is returned by ReadBlocks when bs has room for fewer
+// blocks than the batch that was received. The blocks that didn't fit are
+// not discarded: they are buffered and returned by the next call to
+// ReadBlocks.
+var ErrShortBuffer = os.NewError("dccp: short buffer")
+
+// ReadBlocks blocks until at least one application block is available, and
+// copies as many further blocks as are already queued, without blocking
+// again, into the remainder of bs, analogous to readv. It returns the
+// number of blocks copied. If more blocks were already queued than bs has
+// room for, ReadBlocks returns ErrShortBuffer, and the remaining blocks are
+// returned by the next call to ReadBlocks instead of being dropped. Any
+// other non-nil error is ErrClosed, returned only once the reading side of
+// the connection has been closed.
+//
+// ReadBlocks reads directly off the same channel as ReadBlock and
+// ReadBlockCancel: the two APIs may be called concurrently on the same
+// Conn without either one stealing blocks meant for the other.
+func (c *Conn) ReadBlocks(bs [][]byte) (n int, err os.Error) {
+	c.Lock()
+	state := c.socket.GetState()
+	leftover := c.readBatchLeftover
+	c.readBatchLeftover = nil
+	c.Unlock()
+	if state == READ_CLOSED {
+		return 0, ErrClosed
+	}
+	if len(bs) == 0 {
+		return 0, nil
+	}
+	var batch [][]byte
+	if len(leftover) > 0 {
+		batch = leftover
+	} else {
+		select {
+		case b, ok := <-c.readApp:
+			if !ok {
+				return 0, ErrClosed
+			}
+			batch = [][]byte{b}
+		case <-c.readDone:
+			return 0, ErrClosed
+		}
+	}
+	// Receive up to one block beyond len(bs), so that a queue longer than bs
+	// is detected and reported as ErrShortBuffer below.
+drain:
+	for len(batch) <= len(bs) {
+		select {
+		case b, ok := <-c.readApp:
+			if !ok {
+				break drain
+			}
+			batch = append(batch, b)
+		default:
+			break drain
+		}
+	}
+	n = copy(bs, batch)
+	if n < len(batch) {
+		c.Lock()
+		c.readBatchLeftover = batch[n:]
+		c.Unlock()
+		return n, ErrShortBuffer
+	}
+	return n, nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2010 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"os"
+	"time"
+)
+
+// timeoutError is returned by WriteBlockCancel and ReadBlockCancel, as
+// well as by WriteBlock and ReadBlock, once a deadline set with
+// SetDeadline, SetWriteDeadline or SetReadDeadline has passed, or once the
+// caller-supplied cancel channel is closed.
+type timeoutError struct{}
+
+func (timeoutError) String() string { return "dccp: i/o timeout" }
+
+// Timeout returns true, allowing callers to distinguish a deadline expiry
+// from a closed connection with a type assertion, as with net.Error.
+func (timeoutError) Timeout() bool { return true }
+
+// ErrTimeout is returned by WriteBlockCancel and ReadBlockCancel when the
+// operation's deadline passes, or its cancel channel is closed, before the
+// block can be sent or received.
+var ErrTimeout os.Error = timeoutError{}
+
+// deadlineChan returns a channel that becomes ready once deadline passes.
+// If deadline is the zero time, no deadline is in effect and deadlineChan
+// returns nil, which blocks forever in a select — exactly the behavior we
+// want for "no deadline set".
+func deadlineChan(deadline time.Time) <-chan time.Time {
+	if deadline.IsZero() {
+		return nil
+	}
+	left := deadline.Sub(time.Now())
+	if left <= 0 {
+		already := make(chan time.Time, 1)
+		already <- deadline
+		return already
+	}
+	return time.After(left)
+}
+
+// WriteBlockCancel blocks until the slice b is sent, the writing side of
+// the connection is closed (in which case it returns ErrClosed), or the
+// connection's write deadline passes or cancel is closed (in either case it
+// returns ErrTimeout). A nil cancel channel never fires, i.e. it behaves as
+// "no cancellation requested".
+func (c *Conn) WriteBlockCancel(cancel <-chan struct{}, b []byte) os.Error {
+	if len(b) > c.MaxBlockLen() {
+		return ErrTooBig
+	}
+	c.Lock()
+	state := c.socket.GetState()
+	deadline := c.writeDeadline
+	c.Unlock()
+	if state == WRITE_CLOSED || state == CLOSING || state == CLOSEREQ || state == CLOSED || state == TIMEWAIT {
+		return ErrClosed
+	}
+	if state != OPEN && state != READ_CLOSED {
+		return os.EBADF
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	select {
+	case c.writeData <- b:
+		return nil
+	case <-c.writeDone:
+		return ErrClosed
+	case <-cancel:
+		return ErrTimeout
+	case <-deadlineChan(deadline):
+		return ErrTimeout
+	}
+}
+
+// ReadBlockCancel blocks until the next packet of application data is
+// received, the reading side of the connection is closed (in which case it
+// returns ErrClosed), or the connection's read deadline passes or cancel is
+// closed (in either case it returns ErrTimeout). A nil cancel channel never
+// fires, i.e. it behaves as "no cancellation requested".
+func (c *Conn) ReadBlockCancel(cancel <-chan struct{}) (b []byte, err os.Error) {
+	c.Lock()
+	state := c.socket.GetState()
+	deadline := c.readDeadline
+	c.Unlock()
+	if state == READ_CLOSED {
+		return nil, ErrClosed
+	}
+	select {
+	case b, ok := <-c.readApp:
+		if !ok {
+			// readApp can be closed concurrently with c.readDone during
+			// teardown; prefer ErrClosed whenever a close is already under
+			// way, so that a racing caller never observes os.EBADF instead
+			// of the ErrClosed its close contract promises.
+			select {
+			case <-c.readDone:
+				return nil, ErrClosed
+			default:
+				return nil, os.EBADF
+			}
+		}
+		return b, nil
+	case <-c.readDone:
+		return nil, ErrClosed
+	case <-cancel:
+		return nil, ErrTimeout
+	case <-deadlineChan(deadline):
+		return nil, ErrTimeout
+	}
+}
+
+// SetDeadline sets both the read and write deadlines, matching net.Conn.
+// A zero value for t disables the respective deadline.
+func (c *Conn) SetDeadline(t time.Time) os.Error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future calls to ReadBlock and
+// ReadBlockCancel. A zero value for t disables the read deadline.
+func (c *Conn) SetReadDeadline(t time.Time) os.Error {
+	c.Lock()
+	defer c.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future calls to WriteBlock and
+// WriteBlockCancel. A zero value for t disables the write deadline.
+func (c *Conn) SetWriteDeadline(t time.Time) os.Error {
+	c.Lock()
+	defer c.Unlock()
+	c.writeDeadline = t
+	return nil
+}
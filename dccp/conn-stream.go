@@ -0,0 +1,68 @@
+// Copyright 2010 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"io"
+	"os"
+)
+
+// Stream adapts the block-oriented Conn to the standard io.Reader and
+// io.Writer interfaces, so that a DCCP connection can be used with
+// io.Copy, bufio, encoding/gob, net/rpc and other stream-oriented code
+// that cannot otherwise sit on top of Conn.
+type Stream struct {
+	conn *Conn
+	rbuf []byte // leftover bytes from a block that didn't fully fit the caller's slice
+}
+
+// IO returns a Stream that reads and writes c one byte stream at a time,
+// instead of one application block at a time.
+func (c *Conn) IO() io.ReadWriteCloser {
+	return &Stream{conn: c}
+}
+
+// Write splits p into blocks no larger than the connection's MaxBlockLen()
+// and hands each one to WriteBlock in turn, blocking until all of p has
+// been written or an error occurs.
+func (s *Stream) Write(p []byte) (n int, err os.Error) {
+	max := s.conn.MaxBlockLen()
+	for len(p) > 0 {
+		k := len(p)
+		if k > max {
+			k = max
+		}
+		if err = s.conn.WriteBlock(p[:k]); err != nil {
+			return n, err
+		}
+		n += k
+		p = p[k:]
+	}
+	return n, nil
+}
+
+// Read returns bytes left over from a previously received block that did
+// not fully fit into an earlier caller-supplied slice, if any; otherwise
+// it blocks for the next DCCP-DATA block via ReadBlock and returns as much
+// of it as fits in p, buffering the remainder for the next Read. Zero-length
+// blocks are skipped rather than returned, since a (0, nil) result would
+// violate the io.Reader contract and spin io.Copy.
+func (s *Stream) Read(p []byte) (n int, err os.Error) {
+	for len(s.rbuf) == 0 {
+		b, err := s.conn.ReadBlock()
+		if err != nil {
+			return 0, err
+		}
+		s.rbuf = b
+	}
+	n = copy(p, s.rbuf)
+	s.rbuf = s.rbuf[n:]
+	return n, nil
+}
+
+// Close closes the underlying connection, Section 8.3.
+func (s *Stream) Close() os.Error {
+	return s.conn.Close()
+}
@@ -8,55 +8,161 @@ import (
 	"os"
 )
 
-// MaxBlockLen() returns the maximum size of a block that can be passed to WriteBlock
+// ErrClosed is returned by WriteBlock and ReadBlock once the corresponding
+// half of the connection has been shut down, via CloseWrite, CloseRead or
+// Close.
+var ErrClosed = os.NewError("dccp: use of closed connection")
+
+// MaxBlockLen() returns the maximum size of a block that can be passed to
+// WriteBlock. Under WriteBlocks/ReadBlocks, the limit applies per element
+// of the batch, not to the batch as a whole.
 func (c *Conn) MaxBlockLen() int {
-	return c.hc.MaxFootprint() - MAX_OPTIONS_SIZE - getFixedHeaderSize(DataAck, true) 
+	return c.hc.MaxFootprint() - MAX_OPTIONS_SIZE - getFixedHeaderSize(DataAck, true)
 }
 
-// WriteBlock blocks until the slice b is sent.
+// WriteBlock blocks until the slice b is sent, or until the writing side of
+// the connection is closed, concurrently, by CloseWrite or Close, in which
+// case it returns ErrClosed. WriteBlock is a thin wrapper around
+// WriteBlockCancel, passing a nil cancel channel, i.e. no cancellation.
 func (c *Conn) WriteBlock(b []byte) os.Error {
-	if len(b) > c.MaxBlockLen() {
-		return ErrTooBig
+	return c.WriteBlockCancel(nil, b)
+}
+
+// ReadBlock blocks until the next packet of application data is received,
+// or until the reading side of the connection is closed, concurrently, by
+// CloseRead or Close, in which case it returns ErrClosed. It returns
+// os.EBADF once the underlying connection itself has been torn down.
+// ReadBlock is a thin wrapper around ReadBlockCancel, passing a nil cancel
+// channel, i.e. no cancellation.
+func (c *Conn) ReadBlock() (b []byte, err os.Error) {
+	return c.ReadBlockCancel(nil)
+}
+
+// closeWriteDone closes c.writeDone exactly once, unblocking any goroutine
+// currently parked in WriteBlock. It is safe to call concurrently and
+// repeatedly.
+func (c *Conn) closeWriteDone() {
+	c.Lock()
+	defer c.Unlock()
+	if c.writeDoneClosed {
+		return
 	}
+	c.writeDoneClosed = true
+	close(c.writeDone)
+}
+
+// closeReadDone closes c.readDone exactly once, unblocking any goroutine
+// currently parked in ReadBlock. It is safe to call concurrently and
+// repeatedly.
+func (c *Conn) closeReadDone() {
 	c.Lock()
-	state := c.socket.GetState()
-	c.Unlock()
-	if state != OPEN {
-		return os.EBADF
+	defer c.Unlock()
+	if c.readDoneClosed {
+		return
 	}
-	if len(b) == 0 {
+	c.readDoneClosed = true
+	close(c.readDone)
+}
+
+// CloseWrite shuts down the writing side of the connection, Section 8.3.
+// It sends a DCCP CloseReq-equivalent advisory to the peer indicating that
+// no more application data will follow, and causes all future calls to
+// WriteBlock to return ErrClosed. Pending application writes are not
+// drained: a WriteBlock still parked when CloseWrite is called returns
+// ErrClosed without its block being sent, and CloseWrite does not wait for
+// earlier blocks to be acknowledged. ReadBlock is unaffected: it continues to
+// deliver inbound blocks until the peer closes its own writing side, at
+// which point the connection transitions to CLOSING and is fully closed
+// with a single DCCP-Close, Section 8.3.
+func (c *Conn) CloseWrite() os.Error {
+	c.Lock()
+	state := c.socket.GetState()
+	switch state {
+	case OPEN:
+		c.socket.SetState(WRITE_CLOSED)
+		c.Unlock()
+		c.inject(c.generateCloseReq())
+		c.closeWriteDone()
+		return nil
+	case READ_CLOSED:
+		c.Unlock()
+		c.inject(c.generateClose())
+		c.Lock()
+		c.gotoCLOSING()
+		c.Unlock()
+		c.closeWriteDone()
+		c.closeReadDone()
 		return nil
+	case WRITE_CLOSED, CLOSING, CLOSEREQ, CLOSED, TIMEWAIT:
+		c.Unlock()
+		c.closeWriteDone()
+		return nil
+	default:
+		c.Unlock()
+		return os.EBADF
 	}
-	c.writeData <- b
-	return nil
 }
 
-// ReadBlock blocks until the next packet of application data is received.
-// It returns a non-nil error only if the connection has been closed.
-func (c *Conn) ReadBlock() (b []byte, err os.Error) {
-	b, ok := <-c.readApp
-	if !ok {
-		// The connection has been closed
-		return nil, os.EBADF
+// CloseRead shuts down the reading side of the connection. Further inbound
+// application blocks are discarded, and any call to ReadBlock, whether
+// already parked or made afterwards, returns ErrClosed. CloseRead does not
+// tear down the connection: the writing side is unaffected and may still be
+// shut down explicitly via CloseWrite or Close.
+func (c *Conn) CloseRead() os.Error {
+	c.Lock()
+	state := c.socket.GetState()
+	switch state {
+	case OPEN:
+		c.socket.SetState(READ_CLOSED)
+		c.Unlock()
+		c.closeReadDone()
+		return nil
+	case WRITE_CLOSED:
+		c.Unlock()
+		c.inject(c.generateClose())
+		c.Lock()
+		c.gotoCLOSING()
+		c.Unlock()
+		c.closeWriteDone()
+		c.closeReadDone()
+		return nil
+	case READ_CLOSED, CLOSING, CLOSEREQ, CLOSED, TIMEWAIT:
+		c.Unlock()
+		c.closeReadDone()
+		return nil
+	default:
+		c.Unlock()
+		return os.EBADF
 	}
-	return b, nil
 }
 
-// Close closes the connection, Section 8.3
+// Close closes the connection, Section 8.3, shutting down both the reading
+// and writing sides at once. From OPEN, it transitions directly to CLOSING
+// with a single DCCP-Close: unlike CloseWrite, it never sends the CloseReq
+// advisory, since that advisory is only meaningful when the write side is
+// closed while the peer may still be read from. From a half-closed state
+// reached by a prior CloseWrite or CloseRead, it finishes the teardown by
+// delegating to whichever of CloseRead or CloseWrite completes it.
 func (c *Conn) Close() os.Error {
 	c.Lock()
 	state := c.socket.GetState()
 	c.Unlock()
-	if state == CLOSED || state == CLOSEREQ || state == CLOSING || state == TIMEWAIT {
+	switch state {
+	case CLOSED, CLOSEREQ, CLOSING, TIMEWAIT:
 		return nil
-	}
-	if state != OPEN {
+	case OPEN:
+		c.Lock()
+		c.gotoCLOSING()
+		c.Unlock()
+		c.inject(c.generateClose())
+		c.closeWriteDone()
+		c.closeReadDone()
+		return nil
+	case WRITE_CLOSED:
+		return c.CloseRead()
+	case READ_CLOSED:
+		return c.CloseWrite()
+	default:
 		return os.EBADF
 	}
-	// Transition to CLOSING
-	c.inject(c.generateClose())
-	c.Lock()
-	c.gotoCLOSING()
-	c.Unlock()
-	return nil
 }
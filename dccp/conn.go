@@ -0,0 +1,125 @@
+// Copyright 2010 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"sync"
+	"time"
+)
+
+// HeaderConn is the header-level connection that Conn multiplexes
+// application data on top of.
+type HeaderConn interface {
+	MaxFootprint() int
+}
+
+// Conn's socket states. LISTEN through TIMEWAIT mirror the DCCP connection
+// states of Section 4.1 (Figure 2); WRITE_CLOSED and READ_CLOSED are the
+// additional sub-states of OPEN introduced for half-close, Section 8.3.
+const (
+	LISTEN = iota
+	REQUEST
+	RESPOND
+	PARTOPEN
+	OPEN
+	WRITE_CLOSED
+	READ_CLOSED
+	CLOSEREQ
+	CLOSING
+	TIMEWAIT
+	CLOSED
+)
+
+// Socket holds the state of a Conn's connection state machine.
+type Socket struct {
+	sync.Mutex
+	state int
+}
+
+func (s *Socket) GetState() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.state
+}
+
+func (s *Socket) SetState(state int) {
+	s.Lock()
+	defer s.Unlock()
+	s.state = state
+}
+
+// Conn is the application-facing half of a DCCP connection.
+type Conn struct {
+	sync.Mutex
+	hc     HeaderConn
+	socket *Socket
+
+	writeData chan []byte
+	readApp   chan []byte
+
+	// writeDone and readDone are closed exactly once, by closeWriteDone and
+	// closeReadDone respectively, to unblock any goroutine parked in
+	// WriteBlock/WriteBlockCancel or ReadBlock/ReadBlockCancel when the
+	// corresponding half of the connection is shut down.
+	writeDone       chan struct{}
+	readDone        chan struct{}
+	writeDoneClosed bool
+	readDoneClosed  bool
+
+	// readBatchLeftover holds the tail of a batch that didn't fit into
+	// the bs slice passed to the prior ReadBlocks call; it is returned by
+	// the next call instead of being dropped.
+	readBatchLeftover [][]byte
+
+	// writeDeadline and readDeadline are the zero-valued-by-default
+	// deadlines consulted by WriteBlockCancel and ReadBlockCancel.
+	writeDeadline time.Time
+	readDeadline  time.Time
+}
+
+// newConn creates a Conn in the OPEN state atop hc.
+func newConn(hc HeaderConn) *Conn {
+	return &Conn{
+		hc:        hc,
+		socket:    &Socket{state: OPEN},
+		writeData: make(chan []byte),
+		readApp:   make(chan []byte),
+		writeDone: make(chan struct{}),
+		readDone:  make(chan struct{}),
+	}
+}
+
+// inject hands a packet generated by generateClose, generateCloseReq or
+// generateDataBatch to the outgoing header connection.
+func (c *Conn) inject(pkt interface{}) {
+	_ = pkt // wire encoding lives in the header-connection layer
+}
+
+// generateClose produces the DCCP-Close packet that fully tears down the
+// connection, Section 8.3.
+func (c *Conn) generateClose() interface{} {
+	return "Close"
+}
+
+// generateCloseReq produces a DCCP-CloseReq-equivalent packet: an advisory
+// signal that this side will send no more application data, used by
+// CloseWrite to half-close without tearing the connection down.
+func (c *Conn) generateCloseReq() interface{} {
+	return "CloseReq"
+}
+
+// generateDataBatch produces a single DCCP-DataAck packet carrying every
+// block in bs, with option piggybacks for the whole batch, so that
+// WriteBlocks emits one packet and wakes the connection once, rather than
+// once per block.
+func (c *Conn) generateDataBatch(bs [][]byte) interface{} {
+	return bs
+}
+
+// gotoCLOSING transitions the socket to CLOSING. It is only called once
+// both the write and read halves have been shut down.
+func (c *Conn) gotoCLOSING() {
+	c.socket.SetState(CLOSING)
+}